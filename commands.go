@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/AbdunazarovHikmatullo/AnonymBot/i18n"
+)
+
+// CommandHandler handles a single slash command. args is the text after the
+// command name, already split on whitespace.
+type CommandHandler func(b *Bot, userID int64, args []string)
+
+// command bundles a handler with its access rules and /help description.
+type command struct {
+	handler     CommandHandler
+	adminOnly   bool
+	description string
+}
+
+// registerCommand adds command (without the leading "/") to the dispatcher.
+// Later calls with the same name overwrite the earlier registration.
+func (b *Bot) registerCommand(name string, adminOnly bool, description string, handler CommandHandler) {
+	b.commands.Store(name, command{handler: handler, adminOnly: adminOnly, description: description})
+}
+
+// dispatch parses text as a "/command arg1 arg2" line and runs the matching
+// handler. It reports whether text was recognised as a command at all, so
+// callers can fall back to forwarding plain chat messages.
+func (b *Bot) dispatch(userID int64, text string) bool {
+	if !strings.HasPrefix(text, "/") {
+		return false
+	}
+
+	if b.isBanned(userID) && !b.isAdmin(userID) {
+		b.sendMessage(userID, i18n.T(b.languageOf(userID), "moderation.banned"))
+		return true
+	}
+
+	fields := strings.Fields(text)
+	name := strings.TrimPrefix(fields[0], "/")
+	if at := strings.IndexByte(name, '@'); at != -1 {
+		name = name[:at] // strip "@botname" suffix Telegram adds in groups
+	}
+	args := fields[1:]
+
+	value, ok := b.commands.Load(name)
+	if !ok {
+		return false
+	}
+	cmd := value.(command)
+
+	if cmd.adminOnly && !b.isAdmin(userID) {
+		b.sendMessage(userID, "⛔ Эта команда только для администраторов.")
+		return true
+	}
+
+	cmd.handler(b, userID, args)
+	return true
+}
+
+// isAdmin reports whether userID is listed in ADMIN_IDS.
+func (b *Bot) isAdmin(userID int64) bool {
+	_, ok := b.adminIDs[userID]
+	return ok
+}
+
+// parseAdminIDs reads the ADMIN_IDS env var (comma-separated Telegram IDs).
+func parseAdminIDs(raw string) map[int64]struct{} {
+	ids := make(map[int64]struct{})
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			log.Printf("ADMIN_IDS: skipping invalid id %q: %v", part, err)
+			continue
+		}
+		ids[id] = struct{}{}
+	}
+	return ids
+}
+
+// registerDefaultCommands wires up the built-in user and admin commands.
+// Called once from NewBot.
+func (b *Bot) registerDefaultCommands() {
+	b.registerCommand("start", false, "Начать анонимный чат", func(b *Bot, userID int64, args []string) {
+		b.handleStart(userID)
+	})
+	b.registerCommand("stop", false, "Завершить текущий чат", func(b *Bot, userID int64, args []string) {
+		b.stopChat(userID)
+	})
+	b.registerCommand("next", false, "Найти нового собеседника", func(b *Bot, userID int64, args []string) {
+		b.nextPartner(userID)
+	})
+	b.registerCommand("help", false, "Показать список команд", func(b *Bot, userID int64, args []string) {
+		b.handleHelp(userID)
+	})
+	b.registerCommand("lang", false, "Выбрать язык интерфейса", func(b *Bot, userID int64, args []string) {
+		b.handleLang(userID)
+	})
+	b.registerCommand("preference", false, "Настроить фильтры поиска: /preference, /preference age <мин> <макс>, /preference age clear", func(b *Bot, userID int64, args []string) {
+		b.handlePreference(userID, args)
+	})
+	b.registerCommand("age", false, "Указать свой возраст: /age <возраст>", func(b *Bot, userID int64, args []string) {
+		b.handleAge(userID, args)
+	})
+
+	b.registerCommand("stats", true, "Показать статистику бота", func(b *Bot, userID int64, args []string) {
+		b.handleStats(userID)
+	})
+	b.registerCommand("ban", true, "Забанить пользователя: /ban <id>", func(b *Bot, userID int64, args []string) {
+		b.handleBan(userID, args, true)
+	})
+	b.registerCommand("unban", true, "Разбанить пользователя: /unban <id>", func(b *Bot, userID int64, args []string) {
+		b.handleBan(userID, args, false)
+	})
+	b.registerCommand("broadcast", true, "Разослать сообщение всем: /broadcast <msg>", func(b *Bot, userID int64, args []string) {
+		b.handleBroadcast(userID, args)
+	})
+	b.registerCommand("groups", true, "Показать число активных анонимных пар", func(b *Bot, userID int64, args []string) {
+		b.handleGroups(userID)
+	})
+}
+
+// handleHelp enumerates every registered command, admin commands last.
+func (b *Bot) handleHelp(userID int64) {
+	var user, admin []string
+	b.commands.Range(func(key, value any) bool {
+		cmd := value.(command)
+		line := fmt.Sprintf("/%s — %s", key, cmd.description)
+		if cmd.adminOnly {
+			admin = append(admin, line)
+		} else {
+			user = append(user, line)
+		}
+		return true
+	})
+
+	text := "📖 Доступные команды:\n" + strings.Join(user, "\n")
+	if b.isAdmin(userID) && len(admin) > 0 {
+		text += "\n\n🛠 Команды администратора:\n" + strings.Join(admin, "\n")
+	}
+	b.sendMessage(userID, text)
+}
+
+// handleStats reports basic bot-wide counters to an admin.
+func (b *Bot) handleStats(userID int64) {
+	total, err := b.store.CountUsers()
+	if err != nil {
+		log.Printf("storage: count users: %v", err)
+		b.sendMessage(userID, "Не удалось получить статистику.")
+		return
+	}
+
+	b.mu.Lock()
+	inMemory := len(b.users)
+	waiting := len(b.waitingPool)
+	b.mu.Unlock()
+
+	b.sendMessage(userID, fmt.Sprintf(
+		"📊 Статистика:\nВсего пользователей: %d\nАктивно в памяти: %d\nВ ожидании пары: %d\n%s",
+		total, inMemory, waiting, b.rateLimitStatsLine(),
+	))
+}
+
+// handleBan sets or clears the ban flag on the target user ID.
+func (b *Bot) handleBan(userID int64, args []string, banned bool) {
+	if len(args) != 1 {
+		b.sendMessage(userID, "Использование: /ban <id> или /unban <id>")
+		return
+	}
+	targetID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		b.sendMessage(userID, "Некорректный Telegram ID.")
+		return
+	}
+	if err := b.store.SetBanned(targetID, banned); err != nil {
+		log.Printf("storage: set banned for %d: %v", targetID, err)
+		b.sendMessage(userID, "Не удалось обновить статус пользователя.")
+		return
+	}
+
+	b.mu.Lock()
+	if target, ok := b.users[targetID]; ok {
+		target.Banned = banned
+	}
+	b.mu.Unlock()
+
+	if banned {
+		if partnerID, partnerState := b.forceDisconnect(targetID); partnerID != 0 {
+			b.sendMessage(partnerID, i18n.T(partnerState.Language, "chat.partner_left"))
+		}
+		b.sendMessage(userID, fmt.Sprintf("🔨 Пользователь %d забанен.", targetID))
+	} else {
+		b.sendMessage(userID, fmt.Sprintf("✅ Пользователь %d разбанен.", targetID))
+	}
+}
+
+// handleBroadcast sends msg to every user ever seen, not just the ones
+// currently resident in memory.
+func (b *Bot) handleBroadcast(userID int64, args []string) {
+	if len(args) == 0 {
+		b.sendMessage(userID, "Использование: /broadcast <сообщение>")
+		return
+	}
+	msg := strings.Join(args, " ")
+
+	recipients, err := b.store.ListUserIDs()
+	if err != nil {
+		log.Printf("storage: list user ids: %v", err)
+		b.sendMessage(userID, "Не удалось получить список пользователей.")
+		return
+	}
+
+	for _, id := range recipients {
+		b.sendMessage(id, "📢 "+msg)
+	}
+	b.sendMessage(userID, fmt.Sprintf("Разослано %d пользователям.", len(recipients)))
+}
+
+// handleGroups reports how many anonymous chat pairs are currently active.
+// The bot has no concept of Telegram groups; this is the closest analogue.
+func (b *Bot) handleGroups(userID int64) {
+	b.mu.Lock()
+	pairs := 0
+	for _, state := range b.users {
+		if state.Partner != 0 {
+			pairs++
+		}
+	}
+	b.mu.Unlock()
+
+	b.sendMessage(userID, fmt.Sprintf("👥 Активных анонимных пар: %d", pairs/2))
+}
@@ -0,0 +1,116 @@
+// Package i18n loads per-locale message catalogs and looks up translated
+// strings by key, falling back to the default locale when a key or an
+// entire locale is missing.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// Locale is a BCP-47-ish language tag, e.g. "ru", "en", "uz".
+type Locale string
+
+// Default is used whenever a requested locale or key can't be found.
+const Default Locale = "ru"
+
+var (
+	mu       sync.RWMutex
+	catalogs = make(map[Locale]map[string]string)
+)
+
+func init() {
+	if err := loadEmbedded(); err != nil {
+		panic(fmt.Sprintf("i18n: %v", err))
+	}
+}
+
+func loadEmbedded() error {
+	entries, err := localeFS.ReadDir("locales")
+	if err != nil {
+		return fmt.Errorf("read locales dir: %w", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := localeFS.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", entry.Name(), err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("parse %s: %w", entry.Name(), err)
+		}
+		locale := Locale(strings.TrimSuffix(entry.Name(), ".json"))
+		catalogs[locale] = messages
+	}
+	return nil
+}
+
+// T returns the message for key in locale, formatting it with args via
+// fmt.Sprintf if any are given. If locale doesn't have key, it falls back
+// to Default. If Default doesn't have it either, key itself is returned so
+// a missing translation is visible instead of producing empty text.
+func T(locale Locale, key string, args ...any) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if msg, ok := lookup(locale, key); ok {
+		return format(msg, args)
+	}
+	if msg, ok := lookup(Default, key); ok {
+		return format(msg, args)
+	}
+	return key
+}
+
+func lookup(locale Locale, key string) (string, bool) {
+	cat, ok := catalogs[locale]
+	if !ok {
+		return "", false
+	}
+	msg, ok := cat[key]
+	return msg, ok
+}
+
+func format(msg string, args []any) string {
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Supported returns every locale with a loaded catalog, Default first.
+func Supported() []Locale {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	out := make([]Locale, 0, len(catalogs))
+	out = append(out, Default)
+	for locale := range catalogs {
+		if locale != Default {
+			out = append(out, locale)
+		}
+	}
+	return out
+}
+
+// Valid reports whether locale has a loaded catalog.
+func Valid(locale Locale) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := catalogs[locale]
+	return ok
+}
@@ -1,12 +1,20 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golang.org/x/time/rate"
+
+	"github.com/AbdunazarovHikmatullo/AnonymBot/i18n"
+	"github.com/AbdunazarovHikmatullo/AnonymBot/storage"
 )
 
 // UserGender represents the gender of the user
@@ -15,37 +23,172 @@ type UserGender string
 const (
 	Male   UserGender = "male"
 	Female UserGender = "female"
+	Any    UserGender = "any"
 )
 
-// UserState holds the state for each user
+// matchHistorySize bounds how many past partners /next must avoid repeating.
+const matchHistorySize = 10
+
+// AgeRange is an optional inclusive age filter a user can apply to partners.
+type AgeRange struct {
+	Min int
+	Max int
+}
+
+// UserState holds the in-memory, session-scoped view of a user. Anything
+// that must survive a restart lives in storage.User instead and is
+// write-through mirrored here.
 type UserState struct {
-	Gender   UserGender
-	Partner  int64 // Chat partner ID, 0 if none
-	Waiting  bool  // If waiting for a match
+	Gender         UserGender
+	SeekingGender  UserGender // Male, Female, or Any; defaults to Any
+	AgeRange       *AgeRange  // nil means no age filter
+	Age            int
+	Partner        int64 // Chat partner ID, 0 if none
+	Waiting        bool  // If waiting for a match
+	RecentPartners []int64 // ring buffer of the last matchHistorySize partner IDs
+	Language       i18n.Locale
+	Banned         bool
+
+	limiter          *rate.Limiter // per-user token bucket, lazily created
+	notifiedCooldown bool          // whether we've already warned about this cooldown
+}
+
+// remembersPartner reports whether partnerID was one of userID's last
+// matchHistorySize partners, so /next can avoid immediately re-pairing them.
+func (s *UserState) remembersPartner(partnerID int64) bool {
+	for _, id := range s.RecentPartners {
+		if id == partnerID {
+			return true
+		}
+	}
+	return false
+}
+
+// rememberPartner pushes partnerID onto the ring buffer, evicting the oldest
+// entry once the buffer is full.
+func (s *UserState) rememberPartner(partnerID int64) {
+	s.RecentPartners = append(s.RecentPartners, partnerID)
+	if len(s.RecentPartners) > matchHistorySize {
+		s.RecentPartners = s.RecentPartners[len(s.RecentPartners)-matchHistorySize:]
+	}
 }
 
 // Bot struct to hold bot state
 type Bot struct {
 	api           *tgbotapi.BotAPI
+	store         storage.Storage
 	users         map[int64]*UserState
-	maleQueue     []int64
-	femaleQueue   []int64
+	waitingPool   []int64                 // user IDs currently looking for a partner
+	genderIndex   map[UserGender][]int64  // same IDs, bucketed by Gender for faster scans
 	mu            sync.Mutex
+	commands      sync.Map // command name (no "/") -> command
+	adminIDs      map[int64]struct{}
+	mediaAllow    map[mediaType]bool
+
+	globalLimiter *rate.Limiter
+	sendQueue     chan tgbotapi.Chattable
+	sendWG        sync.WaitGroup // in-flight outbound sends; shutdown waits on this
+	userThrottled int64          // atomic: messages dropped by a per-user limiter
+	globalDropped int64          // atomic: messages dropped because the send queue was full
 }
 
-func NewBot(token string) (*Bot, error) {
+func NewBot(token string, store storage.Storage) (*Bot, error) {
 	api, err := tgbotapi.NewBotAPI(token)
 	if err != nil {
 		return nil, err
 	}
-	return &Bot{
-		api:   api,
-		users: make(map[int64]*UserState),
-	}, nil
+	b := &Bot{
+		api:           api,
+		store:         store,
+		users:         make(map[int64]*UserState),
+		genderIndex:   make(map[UserGender][]int64),
+		adminIDs:      parseAdminIDs(os.Getenv("ADMIN_IDS")),
+		mediaAllow:    mediaAllowlistFromEnv(),
+		globalLimiter: newGlobalLimiter(),
+		sendQueue:     make(chan tgbotapi.Chattable, sendQueueSize),
+	}
+	b.registerDefaultCommands()
+	return b, nil
+}
+
+// loadUser returns the in-memory state for userID, lazily hydrating it from
+// storage (or creating a fresh profile) the first time the user is seen.
+func (b *Bot) loadUser(userID int64) *UserState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if state, ok := b.users[userID]; ok {
+		return state
+	}
+
+	state := &UserState{SeekingGender: Any, Language: i18n.Default}
+	record, err := b.store.GetUser(userID)
+	if err != nil {
+		log.Printf("storage: load user %d: %v", userID, err)
+	}
+	now := time.Now()
+	if record == nil {
+		record = &storage.User{ID: userID, Language: string(i18n.Default), CreatedAt: now, LastSeenAt: now}
+		if err := b.store.UpsertUser(record); err != nil {
+			log.Printf("storage: create user %d: %v", userID, err)
+		}
+	} else {
+		state.Gender = UserGender(record.Gender)
+		state.Age = record.Age
+		state.Banned = record.Banned
+		if i18n.Valid(i18n.Locale(record.Language)) {
+			state.Language = i18n.Locale(record.Language)
+		}
+	}
+	b.users[userID] = state
+	return state
+}
+
+// isBanned reports whether userID is currently banned.
+func (b *Bot) isBanned(userID int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state, ok := b.users[userID]
+	return ok && state.Banned
 }
 
-// Run starts the bot
-func (b *Bot) Run() {
+// languageOf returns userID's chosen locale, defaulting to i18n.Default if
+// the user isn't loaded yet.
+func (b *Bot) languageOf(userID int64) i18n.Locale {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if state, ok := b.users[userID]; ok {
+		return state.Language
+	}
+	return i18n.Default
+}
+
+// saveUser write-throughs the current gender/age/ban-exempt fields for userID.
+// Call it whenever a persisted field on UserState changes.
+func (b *Bot) saveUser(userID int64, state *UserState) {
+	record, err := b.store.GetUser(userID)
+	if err != nil || record == nil {
+		record = &storage.User{ID: userID, CreatedAt: time.Now()}
+	}
+	record.Gender = string(state.Gender)
+	record.Age = state.Age
+	record.Language = string(state.Language)
+	record.LastSeenAt = time.Now()
+	if err := b.store.UpsertUser(record); err != nil {
+		log.Printf("storage: save user %d: %v", userID, err)
+	}
+}
+
+// Run starts the bot and blocks until ctx is cancelled, at which point it
+// stops polling, notifies active pairs, persists the waiting pool, and
+// waits for in-flight outbound sends to drain before returning.
+func (b *Bot) Run(ctx context.Context) {
+	// The worker gets its own context so it keeps draining the queue while
+	// shutdown sends restart notices and waits on sendWG.
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	go b.runSendWorker(workerCtx)
+
 	// Set bot commands for menu
 	b.setBotCommands()
 
@@ -54,38 +197,97 @@ func (b *Bot) Run() {
 
 	updates := b.api.GetUpdatesChan(u)
 
-	for update := range updates {
-		if update.CallbackQuery != nil {
-			b.handleCallback(update.CallbackQuery)
-			continue
+	for {
+		select {
+		case <-ctx.Done():
+			b.api.StopReceivingUpdates()
+			b.shutdown()
+			return
+
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			if update.CallbackQuery != nil {
+				b.handleCallback(update.CallbackQuery)
+				continue
+			}
+
+			if update.Message == nil {
+				continue
+			}
+
+			userID := update.Message.From.ID
+			text := update.Message.Text
+
+			b.loadUser(userID)
+			if err := b.store.TouchLastSeen(userID); err != nil {
+				log.Printf("storage: touch last_seen for %d: %v", userID, err)
+			}
+
+			if text != "" && b.dispatch(userID, text) {
+				continue
+			}
+			b.forwardMessage(userID, update.Message)
+		}
+	}
+}
+
+// shutdown notifies every paired user the bot is restarting, persists the
+// waiting pool so it can be restored on the next boot, and waits for
+// already-queued outbound sends to finish.
+func (b *Bot) shutdown() {
+	b.mu.Lock()
+	notify := make([]int64, 0, len(b.users))
+	for id, state := range b.users {
+		if state.Partner != 0 {
+			notify = append(notify, id)
 		}
+	}
+	waiting := append([]int64(nil), b.waitingPool...)
+	b.mu.Unlock()
 
-		if update.Message == nil {
-			continue
+	for _, id := range notify {
+		b.sendMessage(id, i18n.T(b.users[id].Language, "system.restarting"))
+	}
+	for _, id := range waiting {
+		if err := b.store.SetWaiting(id, true); err != nil {
+			log.Printf("storage: persist waiting state for %d: %v", id, err)
 		}
+	}
 
-		userID := update.Message.From.ID
-		text := update.Message.Text
+	log.Println("Waiting for outbound sends to drain...")
+	b.sendWG.Wait()
+}
 
+// restoreWaitingPool re-enqueues users who were still waiting for a match
+// when the bot last shut down.
+func (b *Bot) restoreWaitingPool() {
+	ids, err := b.store.ListWaiting()
+	if err != nil {
+		log.Printf("storage: list waiting users: %v", err)
+		return
+	}
+	for _, id := range ids {
+		state := b.loadUser(id)
 		b.mu.Lock()
-		state, exists := b.users[userID]
-		if !exists {
-			state = &UserState{}
-			b.users[userID] = state
-		}
+		state.Waiting = true
+		b.enqueue(id, state)
 		b.mu.Unlock()
 
-		switch text {
-		case "/start":
-			b.handleStart(userID)
-		case "/stop":
-			b.stopChat(userID)
-		case "/next":
-			b.nextPartner(userID)
-		default:
-			b.forwardMessage(userID, text)
+		// The persisted flag's job is done now that the user is back in the
+		// live pool; the next graceful shutdown will set it again if needed.
+		if err := b.store.SetWaiting(id, false); err != nil {
+			log.Printf("storage: clear waiting state for %d: %v", id, err)
 		}
 	}
+	if len(ids) > 0 {
+		log.Printf("Restored %d users to the waiting pool", len(ids))
+	}
+
+	// Two restored users may already be mutually compatible; don't leave
+	// them parked until some unrelated user triggers the next match pass.
+	b.matchUsers()
 }
 
 // setBotCommands registers commands in BotFather menu
@@ -94,6 +296,8 @@ func (b *Bot) setBotCommands() {
 		{Command: "/start", Description: "🔥 Начать анонимный чат"},
 		{Command: "/stop", Description: "🛑 Завершить чат"},
 		{Command: "/next", Description: "➡️ Найти нового собеседника"},
+		{Command: "/help", Description: "📖 Список команд"},
+		{Command: "/lang", Description: "🌐 Выбрать язык"},
 	}
 	config := tgbotapi.NewSetMyCommands(commands...)
 	_, err := b.api.Request(config)
@@ -102,18 +306,20 @@ func (b *Bot) setBotCommands() {
 	}
 }
 
-// handleStart shows welcome message with inline buttons
+// handleStart shows the welcome message with gender-picking inline buttons.
 func (b *Bot) handleStart(userID int64) {
-	msg := tgbotapi.NewMessage(userID, "🌟 Добро пожаловать в *Таинственный чат*! Найди свою искру анонимно! 😎\nВыбери пол:")
+	state := b.loadUser(userID)
+
+	msg := tgbotapi.NewMessage(userID, i18n.T(state.Language, "start.welcome"))
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("👨 Мужской", "gender_male"),
-			tgbotapi.NewInlineKeyboardButtonData("👩 Женский", "gender_female"),
+			tgbotapi.NewInlineKeyboardButtonData(i18n.T(state.Language, "start.gender_male"), "gender_male"),
+			tgbotapi.NewInlineKeyboardButtonData(i18n.T(state.Language, "start.gender_female"), "gender_female"),
 		),
 	)
 	msg.ReplyMarkup = keyboard
 	msg.ParseMode = "Markdown"
-	b.api.Send(msg)
+	b.enqueueSend(msg)
 }
 
 // handleCallback processes inline button clicks
@@ -121,21 +327,23 @@ func (b *Bot) handleCallback(query *tgbotapi.CallbackQuery) {
 	userID := query.From.ID
 	data := query.Data
 
-	b.mu.Lock()
-	state, exists := b.users[userID]
-	if !exists {
-		state = &UserState{}
-		b.users[userID] = state
-	}
-	b.mu.Unlock()
+	b.loadUser(userID)
 
-	switch data {
-	case "gender_male":
+	switch {
+	case data == "gender_male":
 		b.setGender(userID, Male)
-	case "gender_female":
+	case data == "gender_female":
 		b.setGender(userID, Female)
-	case "start_chat":
+	case data == "start_chat":
 		b.startChat(userID)
+	case strings.HasPrefix(data, "lang_"):
+		b.setLanguage(userID, i18n.Locale(strings.TrimPrefix(data, "lang_")))
+	case data == "pref_any":
+		b.setSeekingGender(userID, Any)
+	case data == "pref_male":
+		b.setSeekingGender(userID, Male)
+	case data == "pref_female":
+		b.setSeekingGender(userID, Female)
 	}
 
 	// Remove inline keyboard after click
@@ -150,135 +358,55 @@ func (b *Bot) setGender(userID int64, gender UserGender) {
 	state.Gender = gender
 	b.mu.Unlock()
 
-	msg := tgbotapi.NewMessage(userID, fmt.Sprintf("🎉 Пол выбран: *%s*! Готов начать анонимную магию? 💬", gender))
+	b.saveUser(userID, state)
+
+	genderLabel := i18n.T(state.Language, "gender."+string(gender))
+	msg := tgbotapi.NewMessage(userID, i18n.T(state.Language, "gender.set", genderLabel))
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔥 Начать чат", "start_chat"),
+			tgbotapi.NewInlineKeyboardButtonData(i18n.T(state.Language, "gender.start_chat_button"), "start_chat"),
 		),
 	)
 	msg.ReplyMarkup = keyboard
 	msg.ParseMode = "Markdown"
-	b.api.Send(msg)
+	b.enqueueSend(msg)
 }
 
-// startChat adds user to queue
-func (b *Bot) startChat(userID int64) {
-	b.mu.Lock()
-	state := b.users[userID]
-	if state.Gender == "" {
-		b.mu.Unlock()
-		b.sendMessage(userID, "Сначала выбери пол через /start.")
-		return
-	}
-	if state.Partner != 0 {
-		b.mu.Unlock()
-		b.sendMessage(userID, "Ты уже в чате! Используй /stop или /next.")
-		return
-	}
-	state.Waiting = true
+// handleLang shows an inline keyboard of every supported locale.
+func (b *Bot) handleLang(userID int64) {
+	state := b.loadUser(userID)
 
-	if state.Gender == Male {
-		b.maleQueue = append(b.maleQueue, userID)
-	} else {
-		b.femaleQueue = append(b.femaleQueue, userID)
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, locale := range i18n.Supported() {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(strings.ToUpper(string(locale)), "lang_"+string(locale)),
+		))
 	}
-	b.mu.Unlock()
-
-	b.sendMessage(userID, "🔎 Ищем твою искру... Останься на связи! 😎")
-	b.matchUsers()
-}
-
-// matchUsers pairs users
-func (b *Bot) matchUsers() {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-
-	for len(b.maleQueue) > 0 && len(b.femaleQueue) > 0 {
-		maleID := b.maleQueue[0]
-		femaleID := b.femaleQueue[0]
-
-		b.maleQueue = b.maleQueue[1:]
-		b.femaleQueue = b.femaleQueue[1:]
-
-		maleState := b.users[maleID]
-		femaleState := b.users[femaleID]
 
-		maleState.Partner = femaleID
-		femaleState.Partner = maleID
-
-		maleState.Waiting = false
-		femaleState.Waiting = false
-
-		b.sendMessage(maleID, "✨ Партнёр найден! Пиши и наслаждайся анонимной магией! 💬\n(/stop — выйти, /next — новый чат)")
-		b.sendMessage(femaleID, "✨ Партнёр найден! Пиши и наслаждайся анонимной магией! 💬\n(/stop — выйти, /next — новый чат)")
-	}
+	msg := tgbotapi.NewMessage(userID, i18n.T(state.Language, "lang.prompt"))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	b.enqueueSend(msg)
 }
 
-// stopChat ends chat
-func (b *Bot) stopChat(userID int64) {
-	b.mu.Lock()
-	state := b.users[userID]
-	if state.Partner == 0 {
-		b.mu.Unlock()
-		b.sendMessage(userID, "Ты не в чате. Начни с /start!")
+// setLanguage persists the chosen locale and confirms it to the user.
+func (b *Bot) setLanguage(userID int64, locale i18n.Locale) {
+	if !i18n.Valid(locale) {
 		return
 	}
 
-	partnerID := state.Partner
-	partnerState := b.users[partnerID]
-
-	state.Partner = 0
-	partnerState.Partner = 0
-
-	b.removeFromQueue(userID)
-	b.removeFromQueue(partnerID)
-
-	b.mu.Unlock()
-
-	b.sendMessage(userID, "🛑 Чат завершён. Хочешь новую искру? Жми /start!")
-	b.sendMessage(partnerID, "🛑 Партнёр завершил чат. Хочешь новый? Жми /start!")
-}
-
-// nextPartner stops and starts new chat
-func (b *Bot) nextPartner(userID int64) {
-	b.stopChat(userID)
-	b.startChat(userID)
-}
-
-// forwardMessage sends message to partner
-func (b *Bot) forwardMessage(userID int64, text string) {
 	b.mu.Lock()
 	state := b.users[userID]
-	partnerID := state.Partner
+	state.Language = locale
 	b.mu.Unlock()
 
-	if partnerID != 0 {
-		b.sendMessage(partnerID, text)
-	} else {
-		b.sendMessage(userID, "Ты не в чате. Жми /start или 'Начать чат'!")
-	}
-}
-
-// removeFromQueue removes user from queues
-func (b *Bot) removeFromQueue(userID int64) {
-	for i, id := range b.maleQueue {
-		if id == userID {
-			b.maleQueue = append(b.maleQueue[:i], b.maleQueue[i+1:]...)
-			return
-		}
-	}
-	for i, id := range b.femaleQueue {
-		if id == userID {
-			b.femaleQueue = append(b.femaleQueue[:i], b.femaleQueue[i+1:]...)
-			return
-		}
-	}
+	b.saveUser(userID, state)
+	b.sendMessage(userID, i18n.T(locale, "lang.set"))
 }
 
 func (b *Bot) sendMessage(userID int64, text string) {
 	msg := tgbotapi.NewMessage(userID, text)
 	msg.ParseMode = "Markdown"
-	b.api.Send(msg)
+	b.enqueueSend(msg)
 }
 
 func main() {
@@ -287,11 +415,26 @@ func main() {
 		log.Fatal("TELEGRAM_BOT_TOKEN environment variable not set")
 	}
 
-	bot, err := NewBot(token)
+	dbPath := os.Getenv("DATABASE_PATH")
+	if dbPath == "" {
+		dbPath = "anonymbot.db"
+	}
+	store, err := storage.Open(dbPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer store.Close()
+
+	bot, err := NewBot(token, store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bot.restoreWaitingPool()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	log.Println("Bot started")
-	bot.Run()
+	bot.Run(ctx)
+	log.Println("Bot stopped")
 }
\ No newline at end of file
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"log"
+
+	"github.com/AbdunazarovHikmatullo/AnonymBot/i18n"
+)
+
+// startChat enters userID into the waiting pool and immediately tries to
+// find them a partner.
+func (b *Bot) startChat(userID int64) {
+	b.mu.Lock()
+	state := b.users[userID]
+	if state.Gender == "" {
+		b.mu.Unlock()
+		b.sendMessage(userID, i18n.T(state.Language, "chat.choose_gender_first"))
+		return
+	}
+	if state.Partner != 0 {
+		b.mu.Unlock()
+		b.sendMessage(userID, i18n.T(state.Language, "chat.already_in_chat"))
+		return
+	}
+	state.Waiting = true
+	b.enqueue(userID, state)
+	b.mu.Unlock()
+
+	b.sendMessage(userID, i18n.T(state.Language, "chat.searching"))
+	b.matchUsers()
+}
+
+// enqueue adds userID to the waiting pool and its gender index. Callers must
+// hold b.mu.
+func (b *Bot) enqueue(userID int64, state *UserState) {
+	b.waitingPool = append(b.waitingPool, userID)
+	b.genderIndex[state.Gender] = append(b.genderIndex[state.Gender], userID)
+}
+
+// dequeue removes userID from the waiting pool and its gender index.
+// Callers must hold b.mu.
+func (b *Bot) dequeue(userID int64) {
+	state, ok := b.users[userID]
+	if !ok {
+		return
+	}
+	b.waitingPool = removeID(b.waitingPool, userID)
+	b.genderIndex[state.Gender] = removeID(b.genderIndex[state.Gender], userID)
+}
+
+func removeID(ids []int64, target int64) []int64 {
+	for i, id := range ids {
+		if id == target {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
+
+// compatible reports whether a and b may be paired: each one's gender
+// preference must accept the other's gender, each one's age (if known) must
+// fall inside the other's age range (if set), and neither must appear in the
+// other's recent match history.
+func compatible(aID int64, a *UserState, bID int64, b *UserState) bool {
+	if a.Banned || b.Banned {
+		return false
+	}
+	if !seeks(a, b.Gender) || !seeks(b, a.Gender) {
+		return false
+	}
+	if !agesCompatible(a, b) {
+		return false
+	}
+	if a.remembersPartner(bID) || b.remembersPartner(aID) {
+		return false
+	}
+	return true
+}
+
+// seeks reports whether state's gender preference accepts a partner of gender g.
+func seeks(state *UserState, g UserGender) bool {
+	return state.SeekingGender == "" || state.SeekingGender == Any || state.SeekingGender == g
+}
+
+// agesCompatible reports whether b's age falls inside a's AgeRange and a's
+// age falls inside b's AgeRange. A nil range means "no preference" for that
+// side, and an unknown age (0) passes any range.
+func agesCompatible(a, b *UserState) bool {
+	if a.AgeRange != nil && b.Age != 0 {
+		if b.Age < a.AgeRange.Min || b.Age > a.AgeRange.Max {
+			return false
+		}
+	}
+	if b.AgeRange != nil && a.Age != 0 {
+		if a.Age < b.AgeRange.Min || a.Age > b.AgeRange.Max {
+			return false
+		}
+	}
+	return true
+}
+
+// matchUsers scans the waiting pool and pairs up every mutually compatible
+// pair it can find, in FIFO order.
+func (b *Bot) matchUsers() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := 0; i < len(b.waitingPool); i++ {
+		userID := b.waitingPool[i]
+		state := b.users[userID]
+
+		partnerID, partnerState, found := b.findPartnerLocked(userID, state)
+		if !found {
+			continue
+		}
+
+		b.dequeue(userID)
+		b.dequeue(partnerID)
+
+		state.Partner = partnerID
+		partnerState.Partner = userID
+		state.Waiting = false
+		partnerState.Waiting = false
+		state.rememberPartner(partnerID)
+		partnerState.rememberPartner(userID)
+
+		b.sendMessage(userID, i18n.T(state.Language, "chat.partner_found"))
+		b.sendMessage(partnerID, i18n.T(partnerState.Language, "chat.partner_found"))
+
+		if err := b.store.IncrStats(userID, 0, 1); err != nil {
+			log.Printf("storage: incr chats_started for %d: %v", userID, err)
+		}
+		if err := b.store.IncrStats(partnerID, 0, 1); err != nil {
+			log.Printf("storage: incr chats_started for %d: %v", partnerID, err)
+		}
+
+		i = -1 // waitingPool mutated; restart the scan from the front
+	}
+}
+
+// findPartnerLocked returns the first user compatible with userID, other
+// than userID itself. Callers must hold b.mu.
+//
+// When state has a specific gender preference, only the matching bucket of
+// b.genderIndex is scanned instead of the whole waiting pool; a preference
+// of Any (or unset) falls back to scanning everyone.
+func (b *Bot) findPartnerLocked(userID int64, state *UserState) (int64, *UserState, bool) {
+	candidates := b.waitingPool
+	if state.SeekingGender != "" && state.SeekingGender != Any {
+		candidates = b.genderIndex[state.SeekingGender]
+	}
+
+	for _, candidateID := range candidates {
+		if candidateID == userID {
+			continue
+		}
+		candidate := b.users[candidateID]
+		if compatible(userID, state, candidateID, candidate) {
+			return candidateID, candidate, true
+		}
+	}
+	return 0, nil, false
+}
+
+// forceDisconnect removes targetID from the waiting pool and, if they're
+// currently paired, ends that chat. Used when an admin bans a user who may
+// already be queued or mid-chat; the caller is responsible for notifying
+// the returned partner, since that send must happen outside b.mu.
+func (b *Bot) forceDisconnect(targetID int64) (partnerID int64, partnerState *UserState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	target, ok := b.users[targetID]
+	if !ok {
+		return 0, nil
+	}
+
+	b.dequeue(targetID)
+	target.Waiting = false
+
+	if target.Partner != 0 {
+		partnerID = target.Partner
+		partnerState = b.users[partnerID]
+		target.Partner = 0
+		if partnerState != nil {
+			partnerState.Partner = 0
+		}
+	}
+	return partnerID, partnerState
+}
+
+// stopChat ends userID's current chat, if any, and notifies both sides.
+func (b *Bot) stopChat(userID int64) {
+	b.mu.Lock()
+	state := b.users[userID]
+	if state.Partner == 0 {
+		b.mu.Unlock()
+		b.sendMessage(userID, i18n.T(state.Language, "chat.not_in_chat"))
+		return
+	}
+
+	partnerID := state.Partner
+	partnerState := b.users[partnerID]
+
+	state.Partner = 0
+	partnerState.Partner = 0
+
+	b.dequeue(userID)
+	b.dequeue(partnerID)
+
+	b.mu.Unlock()
+
+	b.sendMessage(userID, i18n.T(state.Language, "chat.ended"))
+	b.sendMessage(partnerID, i18n.T(partnerState.Language, "chat.partner_left"))
+}
+
+// nextPartner stops and starts new chat
+func (b *Bot) nextPartner(userID int64) {
+	b.stopChat(userID)
+	b.startChat(userID)
+}
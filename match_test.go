@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+func TestCompatible(t *testing.T) {
+	tests := []struct {
+		name string
+		a    *UserState
+		b    *UserState
+		want bool
+	}{
+		{
+			name: "opposite gender, no preference set defaults to any",
+			a:    &UserState{Gender: Male},
+			b:    &UserState{Gender: Female},
+			want: true,
+		},
+		{
+			name: "explicit any accepts any gender",
+			a:    &UserState{Gender: Male, SeekingGender: Any},
+			b:    &UserState{Gender: Male, SeekingGender: Any},
+			want: true,
+		},
+		{
+			name: "one-sided gender filter rejects mismatch",
+			a:    &UserState{Gender: Male, SeekingGender: Female},
+			b:    &UserState{Gender: Male, SeekingGender: Any},
+			want: false,
+		},
+		{
+			name: "mutual gender filter matches",
+			a:    &UserState{Gender: Male, SeekingGender: Female},
+			b:    &UserState{Gender: Female, SeekingGender: Male},
+			want: true,
+		},
+		{
+			name: "age range excludes out-of-range partner",
+			a:    &UserState{Gender: Male, SeekingGender: Any, AgeRange: &AgeRange{Min: 18, Max: 25}},
+			b:    &UserState{Gender: Female, SeekingGender: Any, Age: 40},
+			want: false,
+		},
+		{
+			name: "age range includes in-range partner",
+			a:    &UserState{Gender: Male, SeekingGender: Any, AgeRange: &AgeRange{Min: 18, Max: 25}},
+			b:    &UserState{Gender: Female, SeekingGender: Any, Age: 22},
+			want: true,
+		},
+		{
+			name: "recent partner is skipped",
+			a:    &UserState{Gender: Male, SeekingGender: Any, RecentPartners: []int64{7}},
+			b:    &UserState{Gender: Female, SeekingGender: Any},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compatible(1, tt.a, 7, tt.b)
+			if got != tt.want {
+				t.Errorf("compatible() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRememberPartnerRingBuffer(t *testing.T) {
+	s := &UserState{}
+	for i := int64(0); i < matchHistorySize+5; i++ {
+		s.rememberPartner(i)
+	}
+
+	if len(s.RecentPartners) != matchHistorySize {
+		t.Fatalf("len(RecentPartners) = %d, want %d", len(s.RecentPartners), matchHistorySize)
+	}
+	if s.remembersPartner(0) {
+		t.Error("oldest partner should have been evicted")
+	}
+	if !s.remembersPartner(matchHistorySize + 4) {
+		t.Error("most recent partner should still be remembered")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/AbdunazarovHikmatullo/AnonymBot/i18n"
+)
+
+// handlePreference dispatches /preference: with no args it shows the
+// gender-filter keyboard, "age <min> <max>" sets an age range, and
+// "age clear" removes it.
+func (b *Bot) handlePreference(userID int64, args []string) {
+	state := b.loadUser(userID)
+
+	if len(args) == 0 {
+		b.showPreferenceMenu(userID, state)
+		return
+	}
+
+	if args[0] == "age" {
+		b.handlePreferenceAge(userID, state, args[1:])
+		return
+	}
+
+	b.sendMessage(userID, i18n.T(state.Language, "preference.usage"))
+}
+
+// handleAge sets userID's own age, persisting it so agesCompatible has
+// something real to check a partner's AgeRange against.
+func (b *Bot) handleAge(userID int64, args []string) {
+	state := b.loadUser(userID)
+
+	if len(args) != 1 {
+		b.sendMessage(userID, i18n.T(state.Language, "age.usage"))
+		return
+	}
+
+	age, err := strconv.Atoi(args[0])
+	if err != nil || age <= 0 || age > 120 {
+		b.sendMessage(userID, i18n.T(state.Language, "age.invalid"))
+		return
+	}
+
+	b.mu.Lock()
+	state.Age = age
+	b.mu.Unlock()
+
+	b.saveUser(userID, state)
+	b.sendMessage(userID, i18n.T(state.Language, "age.set", age))
+}
+
+// showPreferenceMenu offers an inline keyboard to pick a gender filter.
+func (b *Bot) showPreferenceMenu(userID int64, state *UserState) {
+	msg := tgbotapi.NewMessage(userID, i18n.T(state.Language, "preference.prompt"))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(i18n.T(state.Language, "preference.any"), "pref_any"),
+			tgbotapi.NewInlineKeyboardButtonData(i18n.T(state.Language, "preference.male"), "pref_male"),
+			tgbotapi.NewInlineKeyboardButtonData(i18n.T(state.Language, "preference.female"), "pref_female"),
+		),
+	)
+	b.enqueueSend(msg)
+}
+
+// setSeekingGender applies a gender filter chosen from the /preference keyboard.
+func (b *Bot) setSeekingGender(userID int64, gender UserGender) {
+	b.mu.Lock()
+	state := b.users[userID]
+	state.SeekingGender = gender
+	b.mu.Unlock()
+
+	label := i18n.T(state.Language, "preference."+string(gender))
+	b.sendMessage(userID, i18n.T(state.Language, "preference.set", label))
+}
+
+// handlePreferenceAge parses "<min> <max>" or "clear" and updates state.AgeRange.
+func (b *Bot) handlePreferenceAge(userID int64, state *UserState, args []string) {
+	if len(args) == 1 && args[0] == "clear" {
+		b.mu.Lock()
+		state.AgeRange = nil
+		b.mu.Unlock()
+		b.sendMessage(userID, i18n.T(state.Language, "preference.age_cleared"))
+		return
+	}
+
+	if len(args) != 2 {
+		b.sendMessage(userID, i18n.T(state.Language, "preference.age_usage"))
+		return
+	}
+
+	min, errMin := strconv.Atoi(args[0])
+	max, errMax := strconv.Atoi(args[1])
+	if errMin != nil || errMax != nil || min <= 0 || max < min {
+		b.sendMessage(userID, i18n.T(state.Language, "preference.age_invalid"))
+		return
+	}
+
+	b.mu.Lock()
+	state.AgeRange = &AgeRange{Min: min, Max: max}
+	b.mu.Unlock()
+
+	b.sendMessage(userID, i18n.T(state.Language, "preference.age_set", min, max))
+}
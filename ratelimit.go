@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultUserRatePerSec   = 1.0
+	defaultUserBurst        = 5
+	defaultGlobalRatePerSec = 25.0 // stay under Telegram's 30 msg/s hard limit
+	defaultGlobalBurst      = 30
+	sendQueueSize           = 256
+)
+
+// newUserLimiter builds the per-user token bucket, sized from
+// RATE_LIMIT_PER_SEC / RATE_LIMIT_BURST (both optional).
+func newUserLimiter() *rate.Limiter {
+	r := envFloat("RATE_LIMIT_PER_SEC", defaultUserRatePerSec)
+	b := envInt("RATE_LIMIT_BURST", defaultUserBurst)
+	return rate.NewLimiter(rate.Limit(r), b)
+}
+
+// newGlobalLimiter builds the process-wide token bucket shared by every
+// outbound send, sized from GLOBAL_RATE_LIMIT_PER_SEC / GLOBAL_RATE_BURST.
+func newGlobalLimiter() *rate.Limiter {
+	r := envFloat("GLOBAL_RATE_LIMIT_PER_SEC", defaultGlobalRatePerSec)
+	b := envInt("GLOBAL_RATE_BURST", defaultGlobalBurst)
+	return rate.NewLimiter(rate.Limit(r), b)
+}
+
+func envFloat(key string, fallback float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		log.Printf("%s: invalid value %q, using default %v", key, raw, fallback)
+		return fallback
+	}
+	return v
+}
+
+func envInt(key string, fallback int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("%s: invalid value %q, using default %v", key, raw, fallback)
+		return fallback
+	}
+	return v
+}
+
+// allowUserSend checks userID's per-user token bucket. The first time it
+// trips, the caller is told to show a cooldown message; further drops stay
+// silent until the bucket refills and lets a message through again.
+func (b *Bot) allowUserSend(userID int64, state *UserState) (allowed bool, shouldNotify bool) {
+	if state.limiter == nil {
+		state.limiter = newUserLimiter()
+	}
+	if state.limiter.Allow() {
+		state.notifiedCooldown = false
+		return true, false
+	}
+	atomic.AddInt64(&b.userThrottled, 1)
+	shouldNotify = !state.notifiedCooldown
+	state.notifiedCooldown = true
+	return false, shouldNotify
+}
+
+// enqueueSend pushes an outbound message onto the rate-limited send queue.
+// If the queue is full (the global limiter is badly backed up), the send is
+// dropped rather than growing memory without bound.
+func (b *Bot) enqueueSend(msg tgbotapi.Chattable) {
+	b.sendWG.Add(1)
+	select {
+	case b.sendQueue <- msg:
+	default:
+		b.sendWG.Done()
+		atomic.AddInt64(&b.globalDropped, 1)
+		log.Printf("send queue full, dropping outbound message")
+	}
+}
+
+// runSendWorker drains the send queue at the global rate limit until ctx is
+// cancelled. It is started once from Run.
+func (b *Bot) runSendWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-b.sendQueue:
+			if err := b.globalLimiter.Wait(ctx); err != nil {
+				b.sendWG.Done()
+				return
+			}
+			if _, err := b.api.Send(msg); err != nil {
+				log.Printf("send failed: %v", err)
+			}
+			b.sendWG.Done()
+		}
+	}
+}
+
+// rateLimitStatsLine renders the throttle counters for /stats.
+func (b *Bot) rateLimitStatsLine() string {
+	return "Ограничено (пользователь/глобально): " +
+		strconv.FormatInt(atomic.LoadInt64(&b.userThrottled), 10) + "/" +
+		strconv.FormatInt(atomic.LoadInt64(&b.globalDropped), 10)
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// migrations is applied in order on startup. Each entry runs exactly once,
+// tracked in the schema_migrations table, so adding a new entry here is
+// the only thing a future schema change needs to do.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id             INTEGER PRIMARY KEY,
+		gender         TEXT NOT NULL DEFAULT '',
+		age            INTEGER NOT NULL DEFAULT 0,
+		language       TEXT NOT NULL DEFAULT '',
+		banned         BOOLEAN NOT NULL DEFAULT 0,
+		created_at     DATETIME NOT NULL,
+		last_seen_at   DATETIME NOT NULL,
+		messages_sent  INTEGER NOT NULL DEFAULT 0,
+		chats_started  INTEGER NOT NULL DEFAULT 0
+	)`,
+	`ALTER TABLE users ADD COLUMN waiting BOOLEAN NOT NULL DEFAULT 0`,
+}
+
+// SQLiteStorage is a sqlx-backed Storage implementation.
+type SQLiteStorage struct {
+	db *sqlx.DB
+}
+
+// Open connects to the SQLite database at path and runs any pending migrations.
+func Open(path string) (*SQLiteStorage, error) {
+	db, err := sqlx.Connect("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("storage: open %s: %w", path, err)
+	}
+	s := &SQLiteStorage{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLiteStorage) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("storage: create schema_migrations: %w", err)
+	}
+	for version, stmt := range migrations {
+		var applied int
+		if err := s.db.Get(&applied, `SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, version); err != nil {
+			return fmt.Errorf("storage: check migration %d: %w", version, err)
+		}
+		if applied > 0 {
+			continue
+		}
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("storage: apply migration %d: %w", version, err)
+		}
+		if _, err := s.db.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+			return fmt.Errorf("storage: record migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) GetUser(id int64) (*User, error) {
+	var u User
+	err := s.db.Get(&u, `SELECT * FROM users WHERE id = ?`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: get user %d: %w", id, err)
+	}
+	return &u, nil
+}
+
+func (s *SQLiteStorage) UpsertUser(u *User) error {
+	_, err := s.db.NamedExec(`
+		INSERT INTO users (id, gender, age, language, banned, created_at, last_seen_at, messages_sent, chats_started)
+		VALUES (:id, :gender, :age, :language, :banned, :created_at, :last_seen_at, :messages_sent, :chats_started)
+		ON CONFLICT(id) DO UPDATE SET
+			gender = excluded.gender,
+			age = excluded.age,
+			language = excluded.language,
+			banned = excluded.banned,
+			last_seen_at = excluded.last_seen_at,
+			messages_sent = excluded.messages_sent,
+			chats_started = excluded.chats_started
+	`, u)
+	if err != nil {
+		return fmt.Errorf("storage: upsert user %d: %w", u.ID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) TouchLastSeen(id int64) error {
+	_, err := s.db.Exec(`UPDATE users SET last_seen_at = ? WHERE id = ?`, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("storage: touch last_seen for %d: %w", id, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) IncrStats(id int64, messagesSent, chatsStarted int64) error {
+	_, err := s.db.Exec(`
+		UPDATE users SET messages_sent = messages_sent + ?, chats_started = chats_started + ?
+		WHERE id = ?
+	`, messagesSent, chatsStarted, id)
+	if err != nil {
+		return fmt.Errorf("storage: incr stats for %d: %w", id, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) SetBanned(id int64, banned bool) error {
+	_, err := s.db.Exec(`UPDATE users SET banned = ? WHERE id = ?`, banned, id)
+	if err != nil {
+		return fmt.Errorf("storage: set banned for %d: %w", id, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) SetWaiting(id int64, waiting bool) error {
+	_, err := s.db.Exec(`UPDATE users SET waiting = ? WHERE id = ?`, waiting, id)
+	if err != nil {
+		return fmt.Errorf("storage: set waiting for %d: %w", id, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) ListWaiting() ([]int64, error) {
+	var ids []int64
+	if err := s.db.Select(&ids, `SELECT id FROM users WHERE waiting = 1`); err != nil {
+		return nil, fmt.Errorf("storage: list waiting: %w", err)
+	}
+	return ids, nil
+}
+
+func (s *SQLiteStorage) CountUsers() (int, error) {
+	var count int
+	if err := s.db.Get(&count, `SELECT COUNT(*) FROM users`); err != nil {
+		return 0, fmt.Errorf("storage: count users: %w", err)
+	}
+	return count, nil
+}
+
+func (s *SQLiteStorage) ListUserIDs() ([]int64, error) {
+	var ids []int64
+	if err := s.db.Select(&ids, `SELECT id FROM users`); err != nil {
+		return nil, fmt.Errorf("storage: list user ids: %w", err)
+	}
+	return ids, nil
+}
+
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,46 @@
+// Package storage persists bot users so their profile survives restarts.
+package storage
+
+import "time"
+
+// User is a persisted Telegram user profile.
+type User struct {
+	ID            int64     `db:"id"`
+	Gender        string    `db:"gender"`
+	Age           int       `db:"age"`
+	Language      string    `db:"language"`
+	Banned        bool      `db:"banned"`
+	CreatedAt     time.Time `db:"created_at"`
+	LastSeenAt    time.Time `db:"last_seen_at"`
+	MessagesSent  int64     `db:"messages_sent"`
+	ChatsStarted  int64     `db:"chats_started"`
+	Waiting       bool      `db:"waiting"`
+}
+
+// Storage is the persistence contract the bot depends on. It is kept
+// narrow on purpose so an alternative backend (Postgres, in-memory for
+// tests) can be swapped in without touching the handlers.
+type Storage interface {
+	// GetUser returns the stored user, or (nil, nil) if it does not exist yet.
+	GetUser(id int64) (*User, error)
+	// UpsertUser creates the user or, if it already exists, overwrites every
+	// column except created_at and waiting.
+	UpsertUser(u *User) error
+	// TouchLastSeen bumps last_seen_at without loading/saving the full row.
+	TouchLastSeen(id int64) error
+	// IncrStats adds the given deltas to a user's accumulated chat stats.
+	IncrStats(id int64, messagesSent, chatsStarted int64) error
+	// SetBanned flips the ban flag for an admin /ban or /unban command.
+	SetBanned(id int64, banned bool) error
+	// SetWaiting flags whether a user is parked in the match-making pool, so
+	// the pool can be restored after a restart.
+	SetWaiting(id int64, waiting bool) error
+	// ListWaiting returns the IDs of every user flagged as still waiting.
+	ListWaiting() ([]int64, error)
+	// CountUsers returns the total number of known users, for /stats.
+	CountUsers() (int, error)
+	// ListUserIDs returns every known user ID, for admin broadcasts.
+	ListUserIDs() ([]int64, error)
+	// Close releases the underlying connection.
+	Close() error
+}